@@ -7,11 +7,69 @@ package pool
 
 import (
 	"container/heap"
+	"container/list"
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 )
 
+// ErrLeaseStale is returned by Lease.Close when the underlying item was
+// already removed from the pool, for example by a concurrent Clear, before
+// the lease was closed.
+var ErrLeaseStale = errors.New("pool: lease is stale")
+
+// ErrPoolFull is returned by Get and Acquire when MaxTotal is reached, the key
+// is not already in the pool, and there are no idle items left to evict to
+// make room for it.
+var ErrPoolFull = errors.New("pool: full")
+
+// Option configures an Expiring pool. Options are applied in the order they
+// are passed to NewExpiring.
+type Option[K comparable, V any] func(*Expiring[K, V])
+
+// WithMaxIdle limits how many idle elements the pool keeps around. Once the
+// limit is exceeded, the least-recently-released idle item is destructed
+// immediately on Release instead of waiting for its ttl to pass.
+func WithMaxIdle[K comparable, V any](n int) Option[K, V] {
+	return func(p *Expiring[K, V]) {
+		p.maxIdle = n
+	}
+}
+
+// WithMaxTotal limits how many elements, idle or in use, the pool keeps
+// around. Once the limit is reached, Get, Acquire and GetContext evict the
+// least-recently-released idle item to make room for a new key, and return
+// ErrPoolFull if no idle items are left to evict.
+func WithMaxTotal[K comparable, V any](n int) Option[K, V] {
+	return func(p *Expiring[K, V]) {
+		p.maxTotal = n
+	}
+}
+
+// WithContextConstructor sets a constructor variant that accepts a context,
+// preferred over the plain constructor passed to NewExpiring whenever a key
+// needs to be constructed, regardless of whether Get, Acquire or GetContext
+// is the call that triggers it. It receives the context of whichever of
+// those calls triggered the construction, or context.Background() if that
+// was Get or Acquire; callers that join an already in-flight construction do
+// not affect which context it receives.
+func WithContextConstructor[K comparable, V any](constructor func(ctx context.Context, key K) (V, error)) Option[K, V] {
+	return func(p *Expiring[K, V]) {
+		p.ctxConstructor = constructor
+	}
+}
+
+// WithErrorHandler sets a handler that is called with destructor errors
+// produced by the background janitor started with Start, which otherwise has
+// no caller to return them to.
+func WithErrorHandler[K comparable, V any](h func(error)) Option[K, V] {
+	return func(p *Expiring[K, V]) {
+		p.errorHandler = h
+	}
+}
+
 // Expiring is a pool of elements associated with string keys that have an
 // expiration time after no one is using them.
 //
@@ -19,61 +77,223 @@ import (
 // or Prune function call. There is no assurances that the eviction will happen
 // at the expiration time, just that it will not happen before.
 type Expiring[K comparable, V any] struct {
-	constructor func(key K) (V, error)
-	destructor  func(V) error
-	pq          *priorityQueue[K, V]
-	m           map[K]*item[K, V]
-	mu          sync.Mutex
+	constructor    func(key K) (V, error)
+	ctxConstructor func(ctx context.Context, key K) (V, error)
+	destructor     func(V) error
+	pq             *priorityQueue[K, V]
+	m              map[K]*item[K, V]
+	pending        map[K]*pendingGet[K, V]
+	idle           *list.List // idle items in LRU order; front is most recently released
+	mu             sync.Mutex
+	maxIdle        int // 0 means unbounded
+	maxTotal       int // 0 means unbounded
+	errorHandler   func(error)
+
+	janitorMu   sync.Mutex
+	janitorStop chan struct{}
+	janitorDone chan struct{}
 }
 
 // NewExpiring creates a new Expiring pool with constructor and destructor for
-// functions for pool elements.
+// functions for pool elements. By default the pool is unbounded; use
+// WithMaxIdle and WithMaxTotal to cap it.
 func NewExpiring[K comparable, V any](
 	constructor func(key K) (V, error), // function that construct new elements
 	destructor func(V) error,
+	opts ...Option[K, V],
 ) *Expiring[K, V] {
 	pq := make(priorityQueue[K, V], 0)
-	return &Expiring[K, V]{
+	p := &Expiring[K, V]{
 		constructor: constructor,
 		destructor:  destructor,
 		pq:          &pq,
 		m:           make(map[K]*item[K, V]),
+		idle:        list.New(),
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 // Get retrieves a value from the pool referenced by the key. If the value is
 // not in the pool, a new instance will be created using the pool's constructor
 // function.
 func (p *Expiring[K, V]) Get(key K) (t V, err error) {
+	i, err := p.acquireItem(context.Background(), key)
+	if err != nil {
+		return t, err
+	}
+	return i.value, nil
+}
+
+// GetContext retrieves a value from the pool referenced by the key, the same
+// way Get does, but without holding the pool's lock across the constructor
+// call, and with support for cancellation.
+//
+// Concurrent Get, Acquire and GetContext calls for a key that is not yet in
+// the pool all coalesce onto a single constructor invocation: only the first
+// caller runs the constructor, and the others wait for its result instead of
+// running the constructor themselves. Waiting for an in-flight construction
+// is aborted when ctx is done, returning ctx.Err(); the pool does not abort
+// the construction itself, which keeps running in the background, so it is
+// never left in an inconsistent state. If every waiter has cancelled by the time
+// the construction finishes successfully, the pool has no caller left to own
+// the value, so it is passed to the destructor instead of being kept around
+// with a zero refcount.
+//
+// If a constructor that accepts a context was set with
+// WithContextConstructor, it is used instead of the plain constructor passed
+// to NewExpiring, and is given the context of the caller that triggered the
+// construction. That constructor therefore sees the triggering caller's ctx
+// become done when that caller cancels, and any error it then returns is
+// returned to every caller still waiting on the construction.
+func (p *Expiring[K, V]) GetContext(ctx context.Context, key K) (t V, err error) {
+	i, err := p.acquireItem(ctx, key)
+	if err != nil {
+		return t, err
+	}
+	return i.value, nil
+}
+
+// acquireItem returns the item for key, constructing it if needed, and backs
+// Get, Acquire and GetContext. Get and Acquire call it with context.Background
+// so that, being non-cancellable, they always wait for the outcome of an
+// in-flight construction instead of running the constructor a second time.
+//
+// Construction for a key not yet in the pool is coalesced through p.pending:
+// only the first caller actually invokes the constructor, outside of p.mu, so
+// that it does not block other callers; everyone else waits on the same
+// pendingGet. This is what keeps Get and GetContext from racing each other
+// into calling the constructor twice and silently clobbering one another's
+// entry in p.m.
+func (p *Expiring[K, V]) acquireItem(ctx context.Context, key K) (*item[K, V], error) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
 
-	i, ok := p.m[key]
-	if !ok {
-		if err := p.Prune(); err != nil {
-			return t, err
+	if i, ok := p.m[key]; ok {
+		i.refCounter++
+		p.pq.remove(i)
+		if i.idleElem != nil {
+			p.idle.Remove(i.idleElem)
+			i.idleElem = nil
 		}
-		v, err := p.constructor(key)
+		err := p.Prune()
+		p.mu.Unlock()
 		if err != nil {
-			return t, err
+			return nil, err
+		}
+		return i, nil
+	}
+
+	pg, inflight := p.pending[key]
+	if !inflight {
+		if err := p.Prune(); err != nil {
+			p.mu.Unlock()
+			return nil, err
+		}
+		// Reserve this key's slot against maxTotal before starting
+		// construction, since len(p.m) alone would undercount keys that
+		// are still being constructed by another caller.
+		if p.maxTotal > 0 && len(p.m)+len(p.pending) >= p.maxTotal {
+			if p.idle.Len() == 0 {
+				p.mu.Unlock()
+				return nil, ErrPoolFull
+			}
+			victim := p.idle.Back().Value.(*item[K, V])
+			if err := p.evictItemLocked(victim); err != nil {
+				p.mu.Unlock()
+				return nil, err
+			}
 		}
-		p.m[key] = &item[K, V]{
-			value:      v,
-			refCounter: 1,
-			index:      -1,
-			key:        key,
+		pg = &pendingGet[K, V]{done: make(chan struct{}), waiters: 1}
+		if p.pending == nil {
+			p.pending = make(map[K]*pendingGet[K, V])
 		}
-		return v, nil
+		p.pending[key] = pg
+		p.mu.Unlock()
+		go p.construct(ctx, key, pg)
+	} else {
+		pg.mu.Lock()
+		pg.waiters++
+		pg.mu.Unlock()
+		p.mu.Unlock()
 	}
 
-	i.refCounter++
-	p.pq.remove(i)
+	for {
+		select {
+		case <-pg.done:
+			pg.mu.Lock()
+			err := pg.err
+			pg.mu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			p.mu.Lock()
+			i := p.m[key]
+			p.mu.Unlock()
+			return i, nil
+		case <-ctx.Done():
+			pg.mu.Lock()
+			if pg.finished {
+				// Construction finished concurrently with our
+				// cancellation; honor the result instead of discarding it.
+				pg.mu.Unlock()
+				continue
+			}
+			pg.waiters--
+			pg.mu.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+}
 
-	if err := p.Prune(); err != nil {
-		return t, err
+// construct runs the pool's constructor for key outside of p.mu, so that it
+// does not block other callers, and publishes the result to pg. The caller
+// that started it has already reserved the key's slot against maxTotal.
+func (p *Expiring[K, V]) construct(ctx context.Context, key K, pg *pendingGet[K, V]) {
+	var v V
+	var err error
+	if p.ctxConstructor != nil {
+		v, err = p.ctxConstructor(ctx, key)
+	} else {
+		v, err = p.constructor(key)
 	}
 
-	return i.value, nil
+	p.mu.Lock()
+	delete(p.pending, key)
+
+	pg.mu.Lock()
+	pg.value, pg.err = v, err
+	pg.finished = true
+	waiters := pg.waiters
+	pg.mu.Unlock()
+
+	if err == nil {
+		if waiters > 0 {
+			p.m[key] = &item[K, V]{
+				value:      v,
+				refCounter: waiters,
+				index:      -1,
+				key:        key,
+			}
+		} else if p.destructor != nil {
+			_ = p.destructor(v) // best effort: no caller is left to observe this error
+		}
+	}
+	p.mu.Unlock()
+
+	close(pg.done)
+}
+
+// pendingGet tracks a single in-flight constructor invocation shared by
+// Get, Acquire and GetContext callers racing for the same key.
+type pendingGet[K comparable, V any] struct {
+	mu       sync.Mutex
+	value    V
+	err      error
+	finished bool
+	waiters  int
+	done     chan struct{}
 }
 
 // Release marks the key in pool as no longer used by the previous Get caller
@@ -87,16 +307,65 @@ func (p *Expiring[K, V]) Release(key K, ttl time.Duration) {
 		return
 	}
 
+	p.releaseLocked(i, ttl)
+}
+
+// Acquire retrieves a value from the pool, the same way Get does, but returns
+// it wrapped in a Lease instead of a bare value. The Lease ties the
+// acquisition to its release: calling Lease.Close releases the value with the
+// ttl passed here, so callers cannot forget to release it or release it with
+// a mismatched key, and can use defer lease.Close() idiomatically.
+func (p *Expiring[K, V]) Acquire(key K, ttl time.Duration) (*Lease[K, V], error) {
+	i, err := p.acquireItem(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	return &Lease[K, V]{pool: p, item: i, ttl: ttl}, nil
+}
+
+// releaseLocked decrements the refcount of i and, once it reaches zero,
+// schedules its expiration using ttl. Callers must hold p.mu.
+func (p *Expiring[K, V]) releaseLocked(i *item[K, V], ttl time.Duration) {
 	i.refCounter--
-	if i.refCounter == 0 {
-		i.deadtime = nowFunc().Add(ttl)
-		heap.Push(p.pq, i)
+	if i.refCounter != 0 {
+		return
+	}
+
+	i.deadtime = nowFunc().Add(ttl)
+	heap.Push(p.pq, i)
+	i.idleElem = p.idle.PushFront(i)
+
+	if p.maxIdle > 0 && p.idle.Len() > p.maxIdle {
+		victim := p.idle.Back().Value.(*item[K, V])
+		// Release has no error return, so a destructor failure here is
+		// dropped; the item is still removed from the pool.
+		_ = p.evictItemLocked(victim)
 	}
 }
 
+// evictItemLocked destructs an idle item, removing it from the pool. Callers
+// must hold p.mu and i must currently be idle (i.e. came from p.idle).
+func (p *Expiring[K, V]) evictItemLocked(i *item[K, V]) error {
+	p.pq.remove(i)
+	p.idle.Remove(i.idleElem)
+	i.idleElem = nil
+	i.destroyed = true
+	delete(p.m, i.key)
+	if p.destructor != nil {
+		return p.destructor(i.value)
+	}
+	return nil
+}
+
 // Prune removes all expired elements.
 func (p *Expiring[K, V]) Prune() error {
-	return p.pq.prune(p.destructor, func(key K) { delete(p.m, key) })
+	return p.pq.prune(p.destructor, func(i *item[K, V]) {
+		delete(p.m, i.key)
+		if i.idleElem != nil {
+			p.idle.Remove(i.idleElem)
+			i.idleElem = nil
+		}
+	})
 }
 
 // Clear removes all elements in the pool regardless if they are expired or not.
@@ -107,8 +376,11 @@ func (p *Expiring[K, V]) Clear() error {
 	for p.pq.Len() > 0 {
 		heap.Pop(p.pq)
 	}
+	p.idle.Init()
 	for k, v := range p.m {
 		delete(p.m, k)
+		v.destroyed = true
+		v.idleElem = nil
 		if p.destructor != nil {
 			if err := p.destructor(v.value); err != nil {
 				return fmt.Errorf("close %v: %w", k, err)
@@ -118,12 +390,128 @@ func (p *Expiring[K, V]) Clear() error {
 	return nil
 }
 
+// Ticker is the subset of time.Ticker used by the janitor goroutine started
+// by Start. It exists so that tests can substitute a controllable ticker
+// instead of a real one.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type realTicker struct{ t *time.Ticker }
+
+func (r realTicker) C() <-chan time.Time { return r.t.C }
+func (r realTicker) Stop()               { r.t.Stop() }
+
+var newTicker = func(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+// Start runs Prune on a ticker with the given interval in a dedicated
+// goroutine, so that expired items are destructed close to their deadtime
+// instead of only on the next Get call. Calling Start again while the janitor
+// is already running is a no-op; call Stop first to change the interval.
+func (p *Expiring[K, V]) Start(interval time.Duration) {
+	p.janitorMu.Lock()
+	defer p.janitorMu.Unlock()
+
+	if p.janitorStop != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	p.janitorStop = stop
+	p.janitorDone = done
+
+	go func() {
+		defer close(done)
+
+		t := newTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C():
+				p.mu.Lock()
+				err := p.Prune()
+				p.mu.Unlock()
+				if err != nil && p.errorHandler != nil {
+					p.errorHandler(err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the janitor goroutine started by Start, waiting for any prune
+// already in progress to finish before returning. It is a no-op, and safe to
+// call, if the janitor is not running or was already stopped.
+func (p *Expiring[K, V]) Stop() error {
+	p.janitorMu.Lock()
+	stop := p.janitorStop
+	done := p.janitorDone
+	p.janitorStop = nil
+	p.janitorDone = nil
+	p.janitorMu.Unlock()
+
+	if stop == nil {
+		return nil
+	}
+
+	close(stop)
+	<-done
+	return nil
+}
+
+// Lease is a handle on a value acquired from an Expiring pool that ties the
+// release of the value to the closing of the lease, instead of relying on a
+// separate Release call with a key and ttl that have to match the original
+// Get.
+type Lease[K comparable, V any] struct {
+	pool   *Expiring[K, V]
+	item   *item[K, V]
+	ttl    time.Duration
+	closed bool
+}
+
+// Value returns the leased value.
+func (l *Lease[K, V]) Value() V {
+	return l.item.value
+}
+
+// Close releases the leased value back to the pool using the ttl that was
+// passed to Acquire. It is idempotent: calling it more than once only
+// releases the value on the first call. If the underlying item was already
+// removed from the pool by Clear or Prune racing with a late Close,
+// ErrLeaseStale is returned and the pool's refcount is left untouched.
+func (l *Lease[K, V]) Close() error {
+	l.pool.mu.Lock()
+	defer l.pool.mu.Unlock()
+
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+
+	if l.item.destroyed {
+		return ErrLeaseStale
+	}
+
+	l.pool.releaseLocked(l.item, l.ttl)
+	return nil
+}
+
 type item[K, V any] struct {
 	value      V // The value of the item; arbitrary.
 	deadtime   time.Time
 	refCounter int
 	index      int // The index of the item in the heap, needed by remove.
 	key        K
+	destroyed  bool          // Set when the item has been removed from the pool by Clear, Prune or eviction.
+	idleElem   *list.Element // The item's element in Expiring.idle while it is idle, nil otherwise.
 }
 
 // A priorityQueue implements heap.Interface.
@@ -164,7 +552,7 @@ func (pq *priorityQueue[K, V]) remove(i *item[K, V]) {
 	}
 }
 
-func (pq *priorityQueue[K, V]) prune(destructor func(v V) error, callback func(key K)) error {
+func (pq *priorityQueue[K, V]) prune(destructor func(v V) error, callback func(i *item[K, V])) error {
 	now := nowFunc()
 	for l := pq.Len(); l > 0; l = pq.Len() {
 		root := (*pq)[0]
@@ -173,7 +561,8 @@ func (pq *priorityQueue[K, V]) prune(destructor func(v V) error, callback func(k
 		}
 		v := heap.Pop(pq)
 		i := v.(*item[K, V])
-		callback(i.key)
+		i.destroyed = true
+		callback(i)
 		if destructor != nil {
 			if err := destructor(i.value); err != nil {
 				return err
@@ -6,8 +6,12 @@
 package pool_test
 
 import (
+	"context"
+	"errors"
 	"reflect"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -203,6 +207,615 @@ func TestExpiring_Prune(t *testing.T) {
 	assertEqual(t, destructed, []string{"key2", "key3", "key1"})
 }
 
+func TestExpiring_Acquire(t *testing.T) {
+	constructed := make([]string, 0)
+	destructed := make([]string, 0)
+
+	p := pool.NewExpiring(
+		func(key string) (interface{}, error) {
+			constructed = append(constructed, key)
+			return key, nil
+		},
+		func(v interface{}) error {
+			destructed = append(destructed, v.(string))
+			return nil
+		},
+	)
+
+	lease, err := p.Acquire("key1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, lease.Value(), "key1")
+	assertEqual(t, constructed, []string{"key1"})
+	assertEqual(t, destructed, []string{})
+
+	if err := lease.Close(); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, destructed, []string{})
+
+	// Close must be idempotent: a second Close is a no-op that returns nil
+	// and destructs nothing.
+	if err := lease.Close(); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, destructed, []string{})
+
+	pool.SetNowFunc(func() time.Time {
+		return time.Now().Add(time.Hour + time.Minute)
+	})
+	defer pool.SetNowFunc(time.Now)
+
+	if err := p.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, destructed, []string{"key1"})
+}
+
+func TestExpiring_Lease_Close_stale(t *testing.T) {
+	p := pool.NewExpiring(
+		func(key string) (interface{}, error) {
+			return key, nil
+		},
+		func(v interface{}) error {
+			return nil
+		},
+	)
+
+	lease, err := p.Acquire("key1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Clear(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lease.Close(); err != pool.ErrLeaseStale {
+		t.Fatalf("got error %v, want %v", err, pool.ErrLeaseStale)
+	}
+
+	// Closing an already stale lease again must stay idempotent.
+	if err := lease.Close(); err != nil {
+		t.Fatalf("got error %v, want nil", err)
+	}
+}
+
+func TestExpiring_WithMaxIdle(t *testing.T) {
+	destructed := make([]string, 0)
+
+	p := pool.NewExpiring(
+		func(key string) (interface{}, error) {
+			return key, nil
+		},
+		func(v interface{}) error {
+			destructed = append(destructed, v.(string))
+			return nil
+		},
+		pool.WithMaxIdle[string, interface{}](1),
+	)
+
+	if _, err := p.Get("key1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Get("key2"); err != nil {
+		t.Fatal(err)
+	}
+
+	p.Release("key1", time.Hour)
+	assertEqual(t, destructed, []string{})
+
+	// Releasing key2 pushes the idle count over the cap of 1, so the oldest
+	// idle item (key1) is destructed immediately, well before its ttl.
+	p.Release("key2", time.Hour)
+	assertEqual(t, destructed, []string{"key1"})
+}
+
+func TestExpiring_WithMaxIdle_evictionRaceWithGet(t *testing.T) {
+	var evicting int32 // set to 1 once key1's forced eviction has started
+	evictStarted := make(chan struct{})
+	unblockEvict := make(chan struct{})
+	destructed := make(chan string, 2)
+
+	p := pool.NewExpiring(
+		func(key string) (interface{}, error) {
+			return key, nil
+		},
+		func(v interface{}) error {
+			if v.(string) == "key1" && atomic.CompareAndSwapInt32(&evicting, 0, 1) {
+				close(evictStarted)
+				<-unblockEvict
+			}
+			destructed <- v.(string)
+			return nil
+		},
+		pool.WithMaxIdle[string, interface{}](1),
+	)
+
+	if _, err := p.Get("key1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Get("key2"); err != nil {
+		t.Fatal(err)
+	}
+	p.Release("key1", time.Hour) // key1 idle, within the cap of 1
+
+	// Releasing key2 pushes the idle count to 2, over the cap, forcing
+	// key1's eviction. Its destructor blocks so a concurrent Get for key1
+	// can be issued while the eviction (which holds p.mu) is in progress.
+	go p.Release("key2", time.Hour)
+	<-evictStarted
+
+	type getResult struct {
+		v   interface{}
+		err error
+	}
+	getDone := make(chan getResult, 1)
+	go func() {
+		v, err := p.Get("key1")
+		getDone <- getResult{v, err}
+	}()
+
+	close(unblockEvict)
+
+	// The eviction runs, and its destructor call, while Release still holds
+	// p.mu, so it is observed before the concurrent Get can acquire the
+	// lock and proceed.
+	assertEqual(t, <-destructed, "key1")
+
+	got := <-getDone
+	if got.err != nil {
+		t.Fatal(got.err)
+	}
+	// key1 was evicted and destructed exactly once, then reconstructed by
+	// the racing Get rather than being handed a reference to the evicted,
+	// already-destructed item.
+	assertEqual(t, got.v, "key1")
+
+	if err := p.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	remaining := map[string]bool{<-destructed: true, <-destructed: true}
+	if !remaining["key1"] || !remaining["key2"] {
+		t.Fatalf("got destructed %v, want key1 and key2", remaining)
+	}
+}
+
+func TestExpiring_WithMaxTotal(t *testing.T) {
+	constructed := make([]string, 0)
+	destructed := make([]string, 0)
+
+	p := pool.NewExpiring(
+		func(key string) (interface{}, error) {
+			constructed = append(constructed, key)
+			return key, nil
+		},
+		func(v interface{}) error {
+			destructed = append(destructed, v.(string))
+			return nil
+		},
+		pool.WithMaxTotal[string, interface{}](2),
+	)
+
+	if _, err := p.Get("key1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Get("key2"); err != nil {
+		t.Fatal(err)
+	}
+	p.Release("key1", time.Hour)
+
+	// key3 does not exist and the pool is at MaxTotal, but key1 is idle, so
+	// it is evicted to make room.
+	if _, err := p.Get("key3"); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, constructed, []string{"key1", "key2", "key3"})
+	assertEqual(t, destructed, []string{"key1"})
+}
+
+func TestExpiring_WithMaxTotal_errPoolFull(t *testing.T) {
+	p := pool.NewExpiring(
+		func(key string) (interface{}, error) {
+			return key, nil
+		},
+		func(v interface{}) error {
+			return nil
+		},
+		pool.WithMaxTotal[string, interface{}](1),
+	)
+
+	if _, err := p.Get("key1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// key1 is still in use (never released), so there is no idle victim to
+	// evict and the pool must report that it is full.
+	if _, err := p.Get("key2"); err != pool.ErrPoolFull {
+		t.Fatalf("got error %v, want %v", err, pool.ErrPoolFull)
+	}
+
+	p.Release("key1", time.Hour)
+
+	// Once key1 becomes idle it can be evicted to make room for key2.
+	if _, err := p.Get("key2"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpiring_GetContext_coalesce(t *testing.T) {
+	constructed := make(chan struct{})
+	release := make(chan struct{})
+	var constructedCount int32
+
+	p := pool.NewExpiring(
+		func(key string) (interface{}, error) {
+			constructedCount++
+			close(constructed)
+			<-release
+			return key, nil
+		},
+		func(v interface{}) error {
+			return nil
+		},
+	)
+
+	const callers = 5
+	var wg sync.WaitGroup
+	results := make([]interface{}, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = p.GetContext(context.Background(), "key1")
+		}(i)
+	}
+
+	<-constructed
+	close(release)
+	wg.Wait()
+
+	if constructedCount != 1 {
+		t.Fatalf("got %d constructor calls, want 1", constructedCount)
+	}
+	for i := 0; i < callers; i++ {
+		if errs[i] != nil {
+			t.Fatalf("caller %d: unexpected error %v", i, errs[i])
+		}
+		assertEqual(t, results[i], "key1")
+	}
+
+	// Every caller is a distinct owner of the value and must release it.
+	for i := 0; i < callers; i++ {
+		p.Release("key1", time.Hour)
+	}
+	if err := p.Clear(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpiring_GetContext_cancel(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	destructed := make(chan interface{}, 1)
+
+	p := pool.NewExpiring(
+		func(key string) (interface{}, error) {
+			close(started)
+			<-release
+			return key, nil
+		},
+		func(v interface{}) error {
+			destructed <- v
+			return nil
+		},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.GetContext(ctx, "key1")
+		done <- err
+	}()
+
+	<-started
+	cancel()
+
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+
+	// The constructor keeps running after the only waiter cancelled; once it
+	// finishes, nobody owns the value, so it is handed to the destructor
+	// instead of being kept in the pool with a zero refcount.
+	close(release)
+	select {
+	case v := <-destructed:
+		assertEqual(t, v, "key1")
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for destructor")
+	}
+}
+
+func TestExpiring_Get_coalescesWithGetContext(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var constructedCount int32
+
+	p := pool.NewExpiring(
+		func(key string) (interface{}, error) {
+			constructedCount++
+			close(started)
+			<-release
+			return key, nil
+		},
+		func(v interface{}) error {
+			return nil
+		},
+	)
+
+	getContextDone := make(chan error, 1)
+	go func() {
+		_, err := p.GetContext(context.Background(), "key1")
+		getContextDone <- err
+	}()
+
+	<-started
+
+	type getResult struct {
+		v   interface{}
+		err error
+	}
+	getDone := make(chan getResult, 1)
+	go func() {
+		v, err := p.Get("key1")
+		getDone <- getResult{v, err}
+	}()
+
+	close(release)
+
+	if err := <-getContextDone; err != nil {
+		t.Fatal(err)
+	}
+	got := <-getDone
+	if got.err != nil {
+		t.Fatal(got.err)
+	}
+
+	// Get must join the in-flight GetContext construction instead of
+	// running the constructor a second time and clobbering its entry.
+	if constructedCount != 1 {
+		t.Fatalf("got %d constructor calls, want 1", constructedCount)
+	}
+	assertEqual(t, got.v, "key1")
+
+	// Both callers own a reference; both must be released before the item
+	// can be evicted from the pool.
+	p.Release("key1", time.Hour)
+	p.Release("key1", time.Hour)
+	if err := p.Clear(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpiring_GetContext_maxTotal(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	p := pool.NewExpiring(
+		func(key string) (interface{}, error) {
+			if key == "key2" {
+				close(started)
+				<-release
+			}
+			return key, nil
+		},
+		func(v interface{}) error {
+			return nil
+		},
+		pool.WithMaxTotal[string, interface{}](2),
+	)
+
+	if _, err := p.Get("key1"); err != nil {
+		t.Fatal(err)
+	}
+
+	getContextDone := make(chan error, 1)
+	go func() {
+		_, err := p.GetContext(context.Background(), "key2")
+		getContextDone <- err
+	}()
+
+	<-started
+
+	// key1 is still in use (never released) and key2's construction has
+	// already been admitted, reserving the pool's second and last slot, so
+	// the pool is effectively at MaxTotal with no idle victim: a third new
+	// key must be rejected, not let through.
+	if _, err := p.Get("key3"); err != pool.ErrPoolFull {
+		t.Fatalf("got error %v, want %v", err, pool.ErrPoolFull)
+	}
+
+	close(release)
+	if err := <-getContextDone; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpiring_WithContextConstructor(t *testing.T) {
+	plainCalled := false
+
+	p := pool.NewExpiring(
+		func(key string) (interface{}, error) {
+			plainCalled = true
+			return nil, errors.New("plain constructor should not be called")
+		},
+		func(v interface{}) error {
+			return nil
+		},
+		pool.WithContextConstructor[string, interface{}](func(ctx context.Context, key string) (interface{}, error) {
+			return key, nil
+		}),
+	)
+
+	got, err := p.Get("key1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, got, "key1")
+	if plainCalled {
+		t.Fatal("plain constructor was called even though WithContextConstructor was set")
+	}
+	p.Release("key1", time.Hour)
+}
+
+func TestExpiring_WithContextConstructor_context(t *testing.T) {
+	type ctxKey struct{}
+	var gotCtx context.Context
+
+	p := pool.NewExpiring(
+		func(key string) (interface{}, error) {
+			return key, nil
+		},
+		func(v interface{}) error {
+			return nil
+		},
+		pool.WithContextConstructor[string, interface{}](func(ctx context.Context, key string) (interface{}, error) {
+			gotCtx = ctx
+			return key, nil
+		}),
+	)
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "marker")
+	if _, err := p.GetContext(ctx, "key1"); err != nil {
+		t.Fatal(err)
+	}
+	if gotCtx.Value(ctxKey{}) != "marker" {
+		t.Fatalf("got context %v, want the GetContext caller's context", gotCtx)
+	}
+	p.Release("key1", time.Hour)
+
+	// Get has no context of its own to pass through, so the context
+	// constructor receives context.Background() instead.
+	gotCtx = nil
+	if _, err := p.Get("key2"); err != nil {
+		t.Fatal(err)
+	}
+	if gotCtx != context.Background() {
+		t.Fatalf("got context %v, want context.Background()", gotCtx)
+	}
+}
+
+type fakeTicker struct {
+	c chan time.Time
+}
+
+func newFakeTicker() *fakeTicker {
+	return &fakeTicker{c: make(chan time.Time, 1)}
+}
+
+func (f *fakeTicker) C() <-chan time.Time { return f.c }
+func (f *fakeTicker) Stop()               {}
+func (f *fakeTicker) tick()               { f.c <- time.Now() }
+
+func TestExpiring_StartStop(t *testing.T) {
+	destructed := make(chan string, 1)
+
+	p := pool.NewExpiring(
+		func(key string) (interface{}, error) {
+			return key, nil
+		},
+		func(v interface{}) error {
+			destructed <- v.(string)
+			return nil
+		},
+	)
+
+	ft := newFakeTicker()
+	pool.SetNewTicker(func(time.Duration) pool.Ticker { return ft })
+	defer pool.SetNewTicker(pool.DefaultNewTicker)
+
+	if _, err := p.Get("key1"); err != nil {
+		t.Fatal(err)
+	}
+	p.Release("key1", time.Hour)
+
+	pool.SetNowFunc(func() time.Time {
+		return time.Now().Add(time.Hour + time.Minute)
+	})
+	defer pool.SetNowFunc(time.Now)
+
+	p.Start(time.Millisecond)
+	defer p.Stop()
+
+	// No Get call happens; the item is destructed purely by the janitor
+	// firing on the (fake, manually driven) ticker.
+	ft.tick()
+
+	select {
+	case v := <-destructed:
+		assertEqual(t, v, "key1")
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for janitor to prune")
+	}
+
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	// Stop must be safe to call more than once.
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpiring_Start_errorHandler(t *testing.T) {
+	wantErr := errors.New("destruct failed")
+	errs := make(chan error, 1)
+
+	p := pool.NewExpiring(
+		func(key string) (interface{}, error) {
+			return key, nil
+		},
+		func(v interface{}) error {
+			return wantErr
+		},
+		pool.WithErrorHandler[string, interface{}](func(err error) {
+			errs <- err
+		}),
+	)
+
+	ft := newFakeTicker()
+	pool.SetNewTicker(func(time.Duration) pool.Ticker { return ft })
+	defer pool.SetNewTicker(pool.DefaultNewTicker)
+
+	if _, err := p.Get("key1"); err != nil {
+		t.Fatal(err)
+	}
+	p.Release("key1", time.Hour)
+
+	pool.SetNowFunc(func() time.Time {
+		return time.Now().Add(time.Hour + time.Minute)
+	})
+	defer pool.SetNowFunc(time.Now)
+
+	p.Start(time.Millisecond)
+	defer p.Stop()
+
+	ft.tick()
+
+	select {
+	case err := <-errs:
+		if err != wantErr {
+			t.Fatalf("got error %v, want %v", err, wantErr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for error handler")
+	}
+}
+
 func assertEqual(t *testing.T, got, want interface{}) {
 	t.Helper()
 
@@ -10,3 +10,11 @@ import "time"
 func SetNowFunc(f func() time.Time) {
 	nowFunc = f
 }
+
+func SetNewTicker(f func(time.Duration) Ticker) {
+	newTicker = f
+}
+
+// DefaultNewTicker is the real, time.Ticker-backed constructor used by the
+// package, so that tests overriding it with SetNewTicker can restore it.
+var DefaultNewTicker = newTicker